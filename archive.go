@@ -2,11 +2,16 @@ package sar
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"io"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
 )
 
 // Type represents the archive type.
@@ -16,6 +21,9 @@ type Type int
 const (
 	// TypeTar represents the Tar archive type.
 	TypeTar Type = 1 + iota
+	// TypeZip represents the Zip archive type. Compression is intrinsic to
+	// zip, so Compressor is ignored for this type.
+	TypeZip
 )
 
 // Compressor represents the compression type.
@@ -23,10 +31,41 @@ type Compressor int
 
 // Constants to identify compression type.
 const (
-	CompressorNone Compressor = iota // CompressNone disables compression.
-	CompressorGzip                   // CompressGzip represents the Gzip compressor.
+	CompressorNone  Compressor = iota // CompressNone disables compression.
+	CompressorGzip                    // CompressGzip represents the Gzip compressor.
+	CompressorBzip2                   // CompressorBzip2 represents the Bzip2 compressor.
+	CompressorXz                      // CompressorXz represents the Xz compressor.
+	CompressorZstd                    // CompressorZstd represents the Zstd compressor.
+
+	// CompressorAuto tells SetupReader to detect the compression used from
+	// the archive's magic number instead of requiring the caller to know it
+	// up front.
+	CompressorAuto
 )
 
+// magicNumbers maps the leading bytes of a stream to the Compressor that
+// produced them.
+var magicNumbers = []struct {
+	compressor Compressor
+	magic      []byte
+}{
+	{CompressorGzip, []byte{0x1F, 0x8B, 0x08}},
+	{CompressorBzip2, []byte{0x42, 0x5A, 0x68}},
+	{CompressorXz, []byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00}},
+	{CompressorZstd, []byte{0x28, 0xB5, 0x2F, 0xFD}},
+}
+
+// DetectCompression inspects the leading bytes of an archive and returns the
+// Compressor whose magic number matches, or CompressorNone if none does.
+func DetectCompression(data []byte) Compressor {
+	for _, m := range magicNumbers {
+		if len(data) >= len(m.magic) && bytes.Equal(data[:len(m.magic)], m.magic) {
+			return m.compressor
+		}
+	}
+	return CompressorNone
+}
+
 // Archive provides access to an archive.
 type Archive struct {
 	Type       Type       // Type specifies the archive type.
@@ -36,14 +75,28 @@ type Archive struct {
 	ReadLimit  int64      // ReadLimit allows to limit the data read.
 	WriteLimit int64      // WriteLimit allows to limit the data written, i.e., the archive size.
 
-	setup     bool
-	closed    bool
-	readbytes int64
+	Progress  Progress // Progress, if set, receives read/write progress updates.
+	RateLimit int64    // RateLimit throttles reading/writing to this many bytes/sec. 0 disables throttling.
+
+	setup         bool
+	closed        bool
+	readbytes     int64
+	progressTotal int64
+
+	uidMaps          []IDMap
+	gidMaps          []IDMap
+	chownOverride    *Ownership
+	allowUnmappedIDs bool
+
+	backend formatBackend
 
-	tarR   *tar.Reader
-	tarW   *tar.Writer
 	pgzipR *pgzip.Reader
 	pgzipW *pgzip.Writer
+	bzip2R io.Reader
+	xzR    *xz.Reader
+	xzW    *xz.Writer
+	zstdR  *zstd.Decoder
+	zstdW  *zstd.Encoder
 }
 
 // WithWriter sets the backing writer.
@@ -70,6 +123,20 @@ func (a *Archive) LimitArchive(limit int64) *Archive {
 	return a
 }
 
+// WithProgress sets the Progress implementation to report read/write
+// progress to.
+func (a *Archive) WithProgress(p Progress) *Archive {
+	a.Progress = p
+	return a
+}
+
+// WithRateLimit throttles reading/writing to the given number of bytes per
+// second.
+func (a *Archive) WithRateLimit(bytesPerSec int64) *Archive {
+	a.RateLimit = bytesPerSec
+	return a
+}
+
 // SetupWriter initializes resources needed for creating an archive.
 func (a *Archive) SetupWriter() error {
 	if a.setup {
@@ -77,22 +144,49 @@ func (a *Archive) SetupWriter() error {
 	}
 
 	w := a.Writer
+	if a.RateLimit > 0 {
+		w = newRateLimitedWriter(w, a.RateLimit)
+	}
 	if a.WriteLimit > 0 {
 		w = NewLimitWriter(w, a.WriteLimit)
 	}
 
-	switch a.Compressor {
-	case CompressorNone:
-	case CompressorGzip:
-		a.pgzipW = pgzip.NewWriter(w)
-		w = a.pgzipW
-	default:
-		return errors.New("compressor not supported")
+	// Compression is intrinsic to zip, selected per entry rather than for
+	// the whole stream, so Compressor only applies to TypeTar.
+	if a.Type != TypeZip {
+		switch a.Compressor {
+		case CompressorNone:
+		case CompressorGzip:
+			a.pgzipW = pgzip.NewWriter(w)
+			w = a.pgzipW
+		case CompressorXz:
+			xzW, err := xz.NewWriter(w)
+			if err != nil {
+				return errors.Wrap(err, "xz.NewWriter")
+			}
+			a.xzW = xzW
+			w = a.xzW
+		case CompressorZstd:
+			zstdW, err := zstd.NewWriter(w)
+			if err != nil {
+				return errors.Wrap(err, "zstd.NewWriter")
+			}
+			a.zstdW = zstdW
+			w = a.zstdW
+		case CompressorBzip2:
+			// The standard library only implements a bzip2 reader, there is
+			// no streaming bzip2 encoder to write against here.
+			return errors.New("bzip2 compression is not supported for writing")
+		default:
+			return errors.New("compressor not supported")
+		}
 	}
 
 	switch a.Type {
 	case TypeTar:
-		a.tarW = tar.NewWriter(w)
+		a.backend = &tarBackend{w: tar.NewWriter(w)}
+	case TypeZip:
+		a.backend = newZipWriterBackend(w)
 	default:
 		return errors.New("archive type not supported")
 	}
@@ -108,25 +202,66 @@ func (a *Archive) SetupReader() error {
 	}
 
 	r := a.Reader
+	if a.RateLimit > 0 {
+		r = newRateLimitedReader(r, a.RateLimit)
+	}
 
 	// TODO: Handle limits
 
-	switch a.Compressor {
-	case CompressorNone:
-	case CompressorGzip:
-		if pgzipR, err := pgzip.NewReader(r); err != nil {
-			return err
-		} else {
-			a.pgzipR = pgzipR
+	// Compression is intrinsic to zip, so detection/decompression is only
+	// relevant for TypeTar; archive/zip reads entries' compression per entry.
+	if a.Type != TypeZip {
+		compressor := a.Compressor
+		if compressor == CompressorAuto {
+			br := bufio.NewReader(r)
+			peek, err := br.Peek(6)
+			if err != nil && err != io.EOF {
+				return errors.Wrap(err, "peek")
+			}
+			compressor = DetectCompression(peek)
+			r = br
+		}
+
+		switch compressor {
+		case CompressorNone:
+		case CompressorGzip:
+			if pgzipR, err := pgzip.NewReader(r); err != nil {
+				return err
+			} else {
+				a.pgzipR = pgzipR
+			}
+			r = a.pgzipR
+		case CompressorBzip2:
+			a.bzip2R = bzip2.NewReader(r)
+			r = a.bzip2R
+		case CompressorXz:
+			xzR, err := xz.NewReader(r)
+			if err != nil {
+				return errors.Wrap(err, "xz.NewReader")
+			}
+			a.xzR = xzR
+			r = a.xzR
+		case CompressorZstd:
+			zstdR, err := zstd.NewReader(r)
+			if err != nil {
+				return errors.Wrap(err, "zstd.NewReader")
+			}
+			a.zstdR = zstdR
+			r = a.zstdR
+		default:
+			return errors.New("compressor not supported")
 		}
-		r = a.pgzipR
-	default:
-		return errors.New("compressor not supported")
 	}
 
 	switch a.Type {
 	case TypeTar:
-		a.tarR = tar.NewReader(r)
+		a.backend = &tarBackend{r: tar.NewReader(r)}
+	case TypeZip:
+		backend, err := newZipReaderBackend(r)
+		if err != nil {
+			return errors.Wrap(err, "newZipReaderBackend")
+		}
+		a.backend = backend
 	default:
 		return errors.New("archive type not supported")
 	}
@@ -143,9 +278,9 @@ func (a *Archive) Close() error {
 	a.closed = true
 
 	var errlist []string
-	if a.tarW != nil {
-		if err := a.tarW.Close(); err != nil {
-			errlist = append(errlist, errors.Wrap(err, "close tar").Error())
+	if a.backend != nil {
+		if err := a.backend.Close(); err != nil {
+			errlist = append(errlist, errors.Wrap(err, "close backend").Error())
 		}
 	}
 	if a.pgzipW != nil {
@@ -158,6 +293,19 @@ func (a *Archive) Close() error {
 			errlist = append(errlist, errors.Wrap(err, "close gzip").Error())
 		}
 	}
+	if a.xzW != nil {
+		if err := a.xzW.Close(); err != nil {
+			errlist = append(errlist, errors.Wrap(err, "close xz").Error())
+		}
+	}
+	if a.zstdW != nil {
+		if err := a.zstdW.Close(); err != nil {
+			errlist = append(errlist, errors.Wrap(err, "close zstd").Error())
+		}
+	}
+	if a.zstdR != nil {
+		a.zstdR.Close()
+	}
 	if len(errlist) > 0 {
 		return errors.New(strings.Join(errlist, ", "))
 	}
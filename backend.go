@@ -0,0 +1,265 @@
+package sar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Entry describes a single archive entry in a format-agnostic way so that
+// ArchivePath/Extract can share their walk/extract/limits/progress code
+// across the supported archive formats.
+type Entry struct {
+	Name     string
+	Size     int64
+	Mode     os.FileMode
+	ModTime  time.Time
+	Uid      int
+	Gid      int
+	Linkname string
+	Typeflag byte // one of the archive/tar Type* constants
+
+	// Devmajor and Devminor are only meaningful for TypeChar/TypeBlock entries.
+	Devmajor int64
+	Devminor int64
+}
+
+// formatBackend abstracts the on-disk archive format (tar, zip, ...).
+type formatBackend interface {
+	// WriteHeader writes e's metadata as the next entry.
+	WriteHeader(e *Entry) error
+	// WriteBody copies size bytes from r as the body of the entry last
+	// passed to WriteHeader.
+	WriteBody(r io.Reader, size int64) error
+
+	// NextHeader advances to, and returns the metadata of, the next entry.
+	// It returns io.EOF once the archive is exhausted.
+	NextHeader() (*Entry, error)
+	// Body returns a reader for the body of the entry last returned by
+	// NextHeader.
+	Body() io.Reader
+
+	Close() error
+}
+
+// entryFromFileInfo builds the format-agnostic Entry for a file system
+// entry named name, with link set to the symlink target if any.
+func entryFromFileInfo(info os.FileInfo, name, link string) *Entry {
+	typeflag := byte(tar.TypeReg)
+	switch {
+	case info.IsDir():
+		typeflag = tar.TypeDir
+	case info.Mode()&os.ModeSymlink != 0:
+		typeflag = tar.TypeSymlink
+	case info.Mode()&os.ModeDevice != 0:
+		if info.Mode()&os.ModeCharDevice != 0 {
+			typeflag = tar.TypeChar
+		} else {
+			typeflag = tar.TypeBlock
+		}
+	}
+
+	e := &Entry{
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     info.Mode(),
+		ModTime:  info.ModTime(),
+		Linkname: link,
+		Typeflag: typeflag,
+	}
+
+	if typeflag == tar.TypeChar || typeflag == tar.TypeBlock {
+		if major, minor, ok := deviceNumbers(info); ok {
+			e.Devmajor, e.Devminor = major, minor
+		}
+	}
+	return e
+}
+
+// tarBackend implements formatBackend on top of archive/tar.
+type tarBackend struct {
+	r *tar.Reader
+	w *tar.Writer
+}
+
+func (b *tarBackend) WriteHeader(e *Entry) error {
+	return b.w.WriteHeader(&tar.Header{
+		Name:     e.Name,
+		Size:     e.Size,
+		Mode:     int64(e.Mode.Perm()),
+		ModTime:  e.ModTime,
+		Uid:      e.Uid,
+		Gid:      e.Gid,
+		Linkname: e.Linkname,
+		Typeflag: e.Typeflag,
+		Devmajor: e.Devmajor,
+		Devminor: e.Devminor,
+	})
+}
+
+func (b *tarBackend) WriteBody(r io.Reader, size int64) error {
+	_, err := io.CopyN(b.w, r, size)
+	return err
+}
+
+func (b *tarBackend) NextHeader() (*Entry, error) {
+	h, err := b.r.Next()
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Name:     h.Name,
+		Size:     h.Size,
+		Mode:     h.FileInfo().Mode(),
+		ModTime:  h.ModTime,
+		Uid:      h.Uid,
+		Gid:      h.Gid,
+		Linkname: h.Linkname,
+		Typeflag: h.Typeflag,
+		Devmajor: h.Devmajor,
+		Devminor: h.Devminor,
+	}, nil
+}
+
+func (b *tarBackend) Body() io.Reader { return b.r }
+
+func (b *tarBackend) Close() error {
+	if b.w != nil {
+		return b.w.Close()
+	}
+	return nil
+}
+
+// zipBackend implements formatBackend on top of archive/zip. Compression is
+// intrinsic to zip (selected per entry rather than for the whole stream), so
+// Archive.Compressor is ignored for TypeZip archives.
+type zipBackend struct {
+	w *zip.Writer
+	c io.Writer // current entry's writer, set by WriteHeader
+
+	entries []*zip.File
+	idx     int
+	body    io.ReadCloser
+}
+
+func newZipWriterBackend(w io.Writer) *zipBackend {
+	return &zipBackend{w: zip.NewWriter(w)}
+}
+
+func newZipReaderBackend(r io.Reader) (*zipBackend, error) {
+	// archive/zip needs an io.ReaderAt plus the stream length to locate the
+	// central directory, so the archive has to be buffered in full.
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return &zipBackend{entries: zr.File}, nil
+}
+
+func (b *zipBackend) WriteHeader(e *Entry) error {
+	fh := &zip.FileHeader{
+		Name:     e.Name,
+		Modified: e.ModTime,
+		Method:   zip.Deflate,
+	}
+	if e.Typeflag == tar.TypeDir && !strings.HasSuffix(fh.Name, "/") {
+		fh.Name += "/"
+	}
+	mode := e.Mode
+	if e.Typeflag == tar.TypeSymlink {
+		mode |= os.ModeSymlink
+	}
+	fh.SetMode(mode)
+
+	w, err := b.w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	b.c = w
+
+	if e.Typeflag == tar.TypeSymlink {
+		// Zip has no dedicated link-target field, so by convention (the one
+		// archive/zip itself documents and the one moby/archive/tar-split use)
+		// the target is stored as the entry's body.
+		if _, err := io.WriteString(b.c, e.Linkname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *zipBackend) WriteBody(r io.Reader, size int64) error {
+	_, err := io.CopyN(b.c, r, size)
+	return err
+}
+
+func (b *zipBackend) NextHeader() (*Entry, error) {
+	if b.body != nil {
+		b.body.Close()
+		b.body = nil
+	}
+	if b.idx >= len(b.entries) {
+		return nil, io.EOF
+	}
+	f := b.entries[b.idx]
+	b.idx++
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	mode := f.Mode()
+	typeflag := byte(tar.TypeReg)
+	switch {
+	case mode.IsDir():
+		typeflag = tar.TypeDir
+	case mode&os.ModeSymlink != 0:
+		typeflag = tar.TypeSymlink
+	}
+
+	e := &Entry{
+		Name:     strings.TrimSuffix(f.Name, "/"),
+		Size:     int64(f.UncompressedSize64),
+		Mode:     mode,
+		ModTime:  f.Modified,
+		Typeflag: typeflag,
+	}
+
+	if typeflag == tar.TypeSymlink {
+		target, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		e.Linkname = string(target)
+		rc = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+
+	b.body = rc
+	return e, nil
+}
+
+func (b *zipBackend) Body() io.Reader { return b.body }
+
+func (b *zipBackend) Close() error {
+	var err error
+	if b.body != nil {
+		err = b.body.Close()
+	}
+	if b.w != nil {
+		if werr := b.w.Close(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
@@ -1,62 +1,350 @@
 package sar
 
 import (
-	"archive/tar"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/moby/patternmatcher"
 	"github.com/pkg/errors"
 )
 
-// ArchivePath archives the given path.
+// ArchiveOptions controls how ArchivePathWithOptions walks and archives a
+// path tree, analogous to Docker's TarOptions.
+type ArchiveOptions struct {
+	// IncludePatterns, if non-empty, restricts archived entries to those
+	// matching at least one of the patterns.
+	IncludePatterns []string
+
+	// ExcludePatterns removes entries matching any of the patterns.
+	// Patterns use gitignore-style syntax, including "!" negation, and an
+	// excluded directory is pruned entirely instead of being descended into.
+	ExcludePatterns []string
+
+	// RebaseNames rewrites the archived name of a source path, keyed by the
+	// path as passed to ArchivePathWithOptions. For example, mapping
+	// "/var/log" to "logs/" archives its contents under "logs/" instead of
+	// "log/".
+	RebaseNames map[string]string
+
+	// FollowSymlinks causes directory symlinks to be traversed and their
+	// contents archived as regular files/directories instead of a single
+	// symlink entry.
+	FollowSymlinks bool
+
+	// IncludeSourceDir controls whether a source path's own base name is
+	// used as a prefix for its contents. Defaults to true.
+	IncludeSourceDir bool
+
+	// ComputeTotal pre-walks paths before archiving to compute the total
+	// uncompressed size of the entries that will be archived, so that
+	// Archive.Progress is given an accurate bytesTotal instead of 0.
+	ComputeTotal bool
+
+	// UIDMaps and GIDMaps translate the on-disk owner of an entry to the
+	// UID/GID stored in the archive, so that archives can be produced
+	// inside user-namespace-style workflows without running as root.
+	UIDMaps []IDMap
+	GIDMaps []IDMap
+
+	// ChownOverride, if set, overrides the UID/GID written for every entry,
+	// applied after UIDMaps/GIDMaps.
+	ChownOverride *Ownership
+
+	// AllowUnmappedIDs disables the UnmappedIDError normally returned for
+	// on-disk IDs that have no matching entry in UIDMaps/GIDMaps.
+	AllowUnmappedIDs bool
+}
+
+// NewArchiveOptions returns a pointer to an ArchiveOptions structure
+// initialized with default values.
+func NewArchiveOptions() *ArchiveOptions {
+	return &ArchiveOptions{
+		IncludeSourceDir: true,
+	}
+}
+
+// patternMatcher builds the patternmatcher.PatternMatcher implementing
+// IncludePatterns/ExcludePatterns, or returns nil if neither is set.
+func (o *ArchiveOptions) patternMatcher() (*patternmatcher.PatternMatcher, error) {
+	if len(o.IncludePatterns) == 0 && len(o.ExcludePatterns) == 0 {
+		return nil, nil
+	}
+
+	var patterns []string
+	if len(o.IncludePatterns) > 0 {
+		// Exclude everything by default, then re-include the requested
+		// patterns, mirroring the common .dockerignore "**" + "!pattern"
+		// idiom.
+		patterns = append(patterns, "**")
+		for _, p := range o.IncludePatterns {
+			patterns = append(patterns, "!"+p)
+		}
+	}
+	patterns = append(patterns, o.ExcludePatterns...)
+
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "pattern matcher")
+	}
+	return pm, nil
+}
+
+// ArchivePath archives the given paths using default options.
 func (a *Archive) ArchivePath(paths ...string) error {
+	return a.ArchivePathWithOptions(NewArchiveOptions(), paths...)
+}
+
+// ArchivePathWithOptions archives the given paths, filtering entries and
+// rewriting names according to opts.
+func (a *Archive) ArchivePathWithOptions(opts *ArchiveOptions, paths ...string) error {
+	if opts == nil {
+		opts = NewArchiveOptions()
+	}
 	if err := a.SetupWriter(); err != nil {
 		return errors.Wrap(err, "setup failed")
 	}
 
+	pm, err := opts.patternMatcher()
+	if err != nil {
+		return err
+	}
+
+	a.uidMaps = opts.UIDMaps
+	a.gidMaps = opts.GIDMaps
+	a.chownOverride = opts.ChownOverride
+	a.allowUnmappedIDs = opts.AllowUnmappedIDs
+
+	if opts.ComputeTotal {
+		total, err := totalSize(paths, opts, pm)
+		if err != nil {
+			return errors.Wrap(err, "compute total size")
+		}
+		a.progressTotal = total
+	}
+
+	seen := map[string]bool{}
 	for _, path := range paths {
 		base := filepath.Clean(path)
 
 		prepend := ""
-		switch filepath.Base(path) {
-		case "..", ".":
-			// Nothing to prepend
-		default:
-			prepend = filepath.Base(path)
+		switch {
+		case opts.RebaseNames[path] != "":
+			prepend = strings.TrimRight(filepath.ToSlash(opts.RebaseNames[path]), "/")
+		case opts.IncludeSourceDir:
+			switch filepath.Base(path) {
+			case "..", ".":
+				// Nothing to prepend
+			default:
+				prepend = filepath.Base(path)
+			}
+		}
+
+		if err := a.walkAndAdd(base, base, prepend, opts, pm, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkAndAdd walks root, archiving entries relative to base with their
+// archive name prefixed by prepend. It is also used, with a different
+// root/base pair, to descend into a directory symlink's target when
+// opts.FollowSymlinks is set; seen tracks the resolved paths already walked
+// to guard against symlink cycles.
+func (a *Archive) walkAndAdd(root, base, prepend string, opts *ArchiveOptions, pm *patternmatcher.PatternMatcher, seen map[string]bool) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
-		err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if opts.FollowSymlinks && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(path)
 			if err != nil {
-				return err
+				return errors.Wrap(err, "stat symlink target")
+			}
+			if target.IsDir() {
+				relpath, err := filepath.Rel(base, path)
+				if err != nil {
+					return errors.Wrap(err, "filepath.Rel")
+				}
+
+				// Apply the pattern filter to the symlink itself, the same
+				// as for a regular directory, before deciding whether to
+				// descend into its target; otherwise IncludePatterns/
+				// ExcludePatterns are silently bypassed for anything
+				// reached through a followed directory symlink. Note this
+				// must return nil, not filepath.SkipDir: the WalkFunc here
+				// was invoked with the symlink's own (non-directory) Lstat
+				// info, and SkipDir on a non-directory entry tells Walk to
+				// skip the rest of the *containing* directory, not just
+				// this one.
+				matched, err := patternMatches(pm, relpath)
+				if err != nil {
+					return err
+				}
+				if matched && !pm.Exclusions() {
+					return nil
+				}
+
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return errors.Wrap(err, "EvalSymlinks")
+				}
+				if seen[real] {
+					return nil
+				}
+				seen[real] = true
+
+				return a.walkAndAdd(real, real, archiveName(relpath, prepend), opts, pm, seen)
 			}
-			relpath, err := filepath.Rel(base, path)
+			info = target
+		}
+
+		relpath, err := filepath.Rel(base, path)
+		if err != nil {
+			return errors.Wrap(err, "filepath.Rel")
+		}
+
+		if relpath == "." {
+			// TODO: If the given path is a symbolic link, should we dereference it?
+			if info.IsDir() {
+				return nil
+			}
+			base := filepath.Base(path)
+			return a.archiveEntry(path, base, base, info, pm)
+		}
+
+		name := archiveName(relpath, prepend)
+		if name == "" {
+			return nil
+		}
+		return a.archiveEntry(path, name, relpath, info, pm)
+	})
+}
+
+// archiveEntry applies the pattern filter and, unless the entry is excluded,
+// adds it to the archive. Patterns are matched against matchPath, the
+// entry's path relative to the walked root, so that callers don't have to
+// account for RebaseNames/IncludeSourceDir when writing IncludePatterns or
+// ExcludePatterns; name, the (possibly rebased/prefixed) archive name, is
+// what actually gets written.
+func (a *Archive) archiveEntry(path, name, matchPath string, info os.FileInfo, pm *patternmatcher.PatternMatcher) error {
+	matched, err := patternMatches(pm, matchPath)
+	if err != nil {
+		return err
+	}
+	if matched {
+		// A matched directory can only be pruned outright if there is no
+		// negated/exclusion pattern that could re-include something
+		// nested inside it; otherwise keep walking and let nested
+		// entries be filtered individually, mirroring moby's archive
+		// package.
+		if info.IsDir() && !pm.Exclusions() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	return a.AddEntry(path, name, info)
+}
+
+// totalSize sums the size of the regular files under paths that would be
+// archived by walkAndAdd, honoring opts' pattern filters. It is used to
+// give Archive.Progress an accurate bytesTotal when ComputeTotal is set.
+func totalSize(paths []string, opts *ArchiveOptions, pm *patternmatcher.PatternMatcher) (int64, error) {
+	var total int64
+	seen := map[string]bool{}
+	for _, path := range paths {
+		base := filepath.Clean(path)
+		err := filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
 			if err != nil {
-				return errors.Wrap(err, "filepath.Rel")
+				return err
 			}
-			switch relpath {
-			case ".":
-				// TODO: If the given path if a symbolic link, should we dereference it?
-				if !info.IsDir() {
-					return a.AddEntry(path, filepath.Base(path), info)
+
+			if opts.FollowSymlinks && info.Mode()&os.ModeSymlink != 0 {
+				target, serr := os.Stat(p)
+				if serr != nil {
+					return errors.Wrap(serr, "stat symlink target")
+				}
+				if target.IsDir() {
+					rel, rerr := filepath.Rel(base, p)
+					if rerr != nil {
+						return errors.Wrap(rerr, "filepath.Rel")
+					}
+					matched, merr := patternMatches(pm, rel)
+					if merr != nil {
+						return merr
+					}
+					if matched && !pm.Exclusions() {
+						return nil
+					}
+
+					real, rerr := filepath.EvalSymlinks(p)
+					if rerr != nil {
+						return errors.Wrap(rerr, "EvalSymlinks")
+					}
+					if seen[real] {
+						return nil
+					}
+					seen[real] = true
+					sub, terr := totalSize([]string{real}, opts, pm)
+					if terr != nil {
+						return terr
+					}
+					total += sub
+					return nil
 				}
-				relpath = ""
+				info = target
 			}
-			if prepend != "" {
-				relpath = filepath.Join(prepend, relpath)
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			rel, rerr := filepath.Rel(base, p)
+			if rerr != nil {
+				return errors.Wrap(rerr, "filepath.Rel")
 			}
-			if relpath == "" {
+			matched, merr := patternMatches(pm, rel)
+			if merr != nil {
+				return merr
+			}
+			if matched {
 				return nil
 			}
-			relpath = strings.Replace(relpath, `\`, "/", -1)
-			return a.AddEntry(path, relpath, info)
+
+			total += info.Size()
+			return nil
 		})
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	return total, nil
+}
+
+// patternMatches reports whether relpath matches pm, or false if pm is nil
+// (no patterns configured). It is the single place walkAndAdd, totalSize and
+// archiveEntry consult the pattern matcher, so their exclusion semantics
+// can't drift apart the way walkAndAdd's and totalSize's followed-symlink
+// handling once did.
+func patternMatches(pm *patternmatcher.PatternMatcher, relpath string) (bool, error) {
+	if pm == nil {
+		return false, nil
+	}
+	matched, err := pm.Matches(filepath.ToSlash(relpath))
+	if err != nil {
+		return false, errors.Wrap(err, "pattern match")
+	}
+	return matched, nil
+}
+
+// archiveName joins prepend and relpath into a "/"-separated archive name.
+func archiveName(relpath, prepend string) string {
+	if prepend != "" {
+		relpath = filepath.Join(prepend, relpath)
+	}
+	return strings.Replace(relpath, `\`, "/", -1)
 }
 
 // AddEntry adds a new file system entry to the archive.
@@ -65,12 +353,6 @@ func (a *Archive) AddEntry(path, name string, info os.FileInfo) error {
 		return errors.Wrap(err, "setup failed")
 	}
 
-	switch a.Type {
-	case TypeTar: // OK
-	default:
-		return errors.New("archive type not implemented")
-	}
-
 	link := ""
 	if info.Mode()&os.ModeSymlink != 0 {
 		var err error
@@ -79,13 +361,30 @@ func (a *Archive) AddEntry(path, name string, info os.FileInfo) error {
 		}
 	}
 
-	h, err := tar.FileInfoHeader(info, link)
-	if err != nil {
-		return errors.Wrap(err, "FileInfoHeader")
+	e := entryFromFileInfo(info, name, link)
+
+	if uid, gid, ok := fileOwner(info); ok {
+		mappedUID := uid
+		if v, mok := mapID(uid, a.uidMaps); mok {
+			mappedUID = v
+		} else if !a.allowUnmappedIDs {
+			return UnmappedIDError{Kind: "uid", ID: uid}
+		}
+
+		mappedGID := gid
+		if v, mok := mapID(gid, a.gidMaps); mok {
+			mappedGID = v
+		} else if !a.allowUnmappedIDs {
+			return UnmappedIDError{Kind: "gid", ID: gid}
+		}
+
+		e.Uid, e.Gid = mappedUID, mappedGID
+		if a.chownOverride != nil {
+			e.Uid, e.Gid = a.chownOverride.UID, a.chownOverride.GID
+		}
 	}
 
-	h.Name = name
-	if err := a.tarW.WriteHeader(h); err != nil {
+	if err := a.backend.WriteHeader(e); err != nil {
 		return errors.Wrap(err, "writing header")
 	}
 
@@ -95,16 +394,15 @@ func (a *Archive) AddEntry(path, name string, info os.FileInfo) error {
 			return err
 		}
 		defer fd.Close()
-		if a.ReadLimit > 0 && a.readbytes+h.Size > a.ReadLimit {
+		if a.ReadLimit > 0 && a.readbytes+e.Size > a.ReadLimit {
 			return ReadLimitExceeded{}
 		}
-		n, err := io.CopyN(a.tarW, fd, h.Size)
-		a.readbytes += int64(n)
-		if err != nil {
+		if err := a.backend.WriteBody(fd, e.Size); err != nil {
 			return errors.Wrap(err, "adding file")
 		}
-		if n < h.Size {
-			return errors.Wrap(err, "short read")
+		a.readbytes += e.Size
+		if a.Progress != nil {
+			a.Progress.Update(a.readbytes, a.progressTotal, name)
 		}
 	}
 	return nil
@@ -0,0 +1,164 @@
+package sar
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveNames returns the entry names written to a tar built by calling
+// ArchivePathWithOptions on paths.
+func archiveNames(t *testing.T, opts *ArchiveOptions, paths ...string) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	a := NewTar().WithWriter(&buf)
+	if err := a.ArchivePathWithOptions(opts, paths...); err != nil {
+		t.Fatalf("ArchivePathWithOptions: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var names []string
+	r := tar.NewReader(&buf)
+	for {
+		h, err := r.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TestArchivePathIncludePatternsNested verifies that a one-level-nested
+// IncludePatterns entry (the realistic case, e.g. "keep/file.txt") is
+// actually included instead of the whole tree being pruned before the
+// negated include pattern is ever evaluated.
+func TestArchivePathIncludePatternsNested(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "keep", "file.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "other.txt"), []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewArchiveOptions()
+	opts.IncludeSourceDir = false
+	opts.IncludePatterns = []string{"keep/file.txt"}
+
+	names := archiveNames(t, opts, src)
+	if !hasName(names, "keep/file.txt") {
+		t.Fatalf("names = %v, want to contain keep/file.txt", names)
+	}
+	if hasName(names, "other.txt") {
+		t.Fatalf("names = %v, want to not contain other.txt", names)
+	}
+}
+
+// TestArchivePathIncludePatternsSingleFileRoot verifies that IncludePatterns
+// is matched against a root path that is itself a file, not a directory.
+func TestArchivePathIncludePatternsSingleFileRoot(t *testing.T) {
+	src := t.TempDir()
+	keep := filepath.Join(src, "keep.go")
+	drop := filepath.Join(src, "drop.txt")
+	if err := os.WriteFile(keep, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(drop, []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewArchiveOptions()
+	opts.IncludeSourceDir = false
+	opts.IncludePatterns = []string{"*.go"}
+
+	names := archiveNames(t, opts, keep)
+	if !hasName(names, "keep.go") {
+		t.Fatalf("names = %v, want to contain keep.go", names)
+	}
+
+	names = archiveNames(t, opts, drop)
+	if hasName(names, "drop.txt") {
+		t.Fatalf("names = %v, want to not contain drop.txt", names)
+	}
+}
+
+// TestArchivePathFollowSymlinksHonorsExcludePatterns verifies that
+// ExcludePatterns still applies to a directory reached through a followed
+// symlink, rather than being bypassed because walkAndAdd recurses into the
+// symlink's target without ever consulting the pattern matcher for the
+// symlink path itself.
+func TestArchivePathFollowSymlinksHonorsExcludePatterns(t *testing.T) {
+	src := t.TempDir()
+	realdir := filepath.Join(src, "realdir")
+	if err := os.MkdirAll(realdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(realdir, "secret.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realdir, filepath.Join(src, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewArchiveOptions()
+	opts.IncludeSourceDir = false
+	opts.FollowSymlinks = true
+	opts.ExcludePatterns = []string{"linkdir"}
+
+	names := archiveNames(t, opts, src)
+	if hasName(names, "linkdir/secret.txt") {
+		t.Fatalf("names = %v, want linkdir/secret.txt excluded", names)
+	}
+}
+
+// TestArchivePathFollowSymlinksExcludeKeepsSiblings is a regression test for
+// walkAndAdd returning filepath.SkipDir instead of nil when an excluded
+// followed symlink is encountered: the WalkFunc there is invoked with the
+// symlink's own (non-directory) Lstat info, so SkipDir skips the rest of the
+// containing directory's entries, not just the symlink's own subtree.
+func TestArchivePathFollowSymlinksExcludeKeepsSiblings(t *testing.T) {
+	src := t.TempDir()
+	realdir := filepath.Join(src, "realdir")
+	if err := os.MkdirAll(realdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(realdir, "secret.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realdir, filepath.Join(src, "alinkdir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "zzz_after.txt"), []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewArchiveOptions()
+	opts.IncludeSourceDir = false
+	opts.FollowSymlinks = true
+	opts.ExcludePatterns = []string{"alinkdir"}
+
+	names := archiveNames(t, opts, src)
+	if hasName(names, "alinkdir/secret.txt") {
+		t.Fatalf("names = %v, want alinkdir/secret.txt excluded", names)
+	}
+	if !hasName(names, "zzz_after.txt") {
+		t.Fatalf("names = %v, want zzz_after.txt (a sibling walked after the excluded symlink) present", names)
+	}
+}
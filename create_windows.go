@@ -0,0 +1,15 @@
+// +build windows
+
+package sar
+
+import "os"
+
+// fileOwner is not supported on Windows.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// deviceNumbers is not supported on Windows.
+func deviceNumbers(info os.FileInfo) (major, minor int64, ok bool) {
+	return 0, 0, false
+}
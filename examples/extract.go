@@ -4,8 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	sar "github.com/nmeilick/go-sar"
+	"github.com/nmeilick/go-sar/progress"
 )
 
 // Output an error and exit
@@ -17,6 +19,9 @@ func fail(format string, a ...interface{}) {
 func main() {
 	archive := flag.String("f", "", "Archive file to use")
 	force := flag.Bool("force", false, "Overwrite existing files")
+	showProgress := flag.Bool("progress", false, "Show progress while extracting")
+	bwlimit := flag.String("bwlimit", "", "Limit extraction throughput, e.g. 10MiB/s")
+	useZip := flag.Bool("zip", false, "Extract a zip archive instead of a (possibly compressed) tar archive")
 
 	flag.Parse()
 
@@ -39,13 +44,37 @@ func main() {
 		fail("Failed to open archive: %s", err)
 	}
 
-	a := sar.NewTarGz().WithReader(fd)
+	var a *sar.Archive
+	if *useZip {
+		a = sar.NewZip().WithReader(fd)
+	} else {
+		// CompressorAuto lets a single command handle .tar, .tar.gz,
+		// .tar.bz2, .tar.xz and .tar.zst alike.
+		a = sar.NewTarAuto().WithReader(fd)
+	}
 	opts := sar.NewExtractOptions()
 	opts.Overwrite = *force
 
+	if *bwlimit != "" {
+		limit, err := sar.ParseByteSize(*bwlimit)
+		if err != nil {
+			fail("Invalid --bwlimit value: %s", err)
+		}
+		a.WithRateLimit(limit)
+	}
+
+	var term *progress.Terminal
+	if *showProgress {
+		term = progress.NewTerminal(os.Stderr, 200*time.Millisecond)
+		a.WithProgress(term)
+	}
+
 	if err = a.Extract(dst, opts); err != nil {
 		fail("Extraction failed: %s", err)
 	}
+	if term != nil {
+		term.Done()
+	}
 	a.Close()
 	fd.Close()
 }
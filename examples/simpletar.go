@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	sar "github.com/nmeilick/go-sar"
+	"github.com/nmeilick/go-sar/progress"
 )
 
 // Output an error and exit
@@ -14,10 +17,24 @@ func fail(format string, a ...interface{}) {
 	os.Exit(1)
 }
 
+// repeatedFlag collects the values of a flag that may be given more than once.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string     { return strings.Join(*f, ",") }
+func (f *repeatedFlag) Set(v string) error { *f = append(*f, v); return nil }
+
 func main() {
 	archive := flag.String("f", "", "Archive file to use")
 	amax := flag.Int("limit-archive", 0, "Abort with an error if the archive size exceeds this limit")
 	dmax := flag.Int("limit-data", 0, "Abort with an error if the data to archive exceeds this limit")
+	showProgress := flag.Bool("progress", false, "Show progress while archiving")
+	bwlimit := flag.String("bwlimit", "", "Limit archive throughput, e.g. 10MiB/s")
+	useZip := flag.Bool("zip", false, "Create a zip archive instead of a tar.gz archive")
+
+	var includes, excludes, rebases repeatedFlag
+	flag.Var(&includes, "include", "Only archive paths matching this pattern (may be given multiple times)")
+	flag.Var(&excludes, "exclude", "Do not archive paths matching this pattern (may be given multiple times)")
+	flag.Var(&rebases, "rebase", "Archive a source path under a different name, as src=dst (may be given multiple times)")
 
 	flag.Parse()
 
@@ -34,17 +51,51 @@ func main() {
 		fail("Failed to create archive: %s", err)
 	}
 
-	a := sar.NewTarGz().WithWriter(fd)
+	var a *sar.Archive
+	if *useZip {
+		a = sar.NewZip().WithWriter(fd)
+	} else {
+		a = sar.NewTarGz().WithWriter(fd)
+	}
 	if *amax > 0 {
 		a.LimitArchive(int64(*amax))
 	}
 	if *dmax > 0 {
 		a.LimitData(int64(*dmax))
 	}
+	if *bwlimit != "" {
+		limit, err := sar.ParseByteSize(*bwlimit)
+		if err != nil {
+			fail("Invalid --bwlimit value: %s", err)
+		}
+		a.WithRateLimit(limit)
+	}
 
-	if err = a.ArchivePath(flag.Args()...); err != nil {
+	opts := sar.NewArchiveOptions()
+	opts.IncludePatterns = includes
+	opts.ExcludePatterns = excludes
+	opts.RebaseNames = map[string]string{}
+	for _, r := range rebases {
+		parts := strings.SplitN(r, "=", 2)
+		if len(parts) != 2 {
+			fail("Invalid --rebase value, expected src=dst: %s", r)
+		}
+		opts.RebaseNames[parts[0]] = parts[1]
+	}
+
+	var term *progress.Terminal
+	if *showProgress {
+		term = progress.NewTerminal(os.Stderr, 200*time.Millisecond)
+		a.WithProgress(term)
+		opts.ComputeTotal = true
+	}
+
+	if err = a.ArchivePathWithOptions(opts, flag.Args()...); err != nil {
 		fail("Archiving failed: %s", err)
 	}
+	if term != nil {
+		term.Done()
+	}
 	a.Close()
 	fd.Close()
 }
@@ -26,6 +26,26 @@ type ExtractOptions struct {
 	Stdout            io.Writer
 	Stderr            io.Writer
 	Errors            []error
+
+	// AllowSymlinksOutsideBase disables the containment check performed on
+	// the targets of TypeLink/TypeSymlink entries, allowing them to point
+	// outside base. It defaults to false since allowing this is what makes
+	// Zip-Slip style attacks possible.
+	AllowSymlinksOutsideBase bool
+
+	// UIDMaps and GIDMaps translate the UID/GID stored in the archive back
+	// to the UID/GID to restore on disk, the inverse of ArchiveOptions'
+	// maps of the same name.
+	UIDMaps []IDMap
+	GIDMaps []IDMap
+
+	// ChownOverride, if set, overrides the UID/GID restored for every
+	// entry, applied after UIDMaps/GIDMaps.
+	ChownOverride *Ownership
+
+	// AllowUnmappedIDs disables the UnmappedIDError normally returned for
+	// archived IDs that have no matching entry in UIDMaps/GIDMaps.
+	AllowUnmappedIDs bool
 }
 
 // NewExtractOptions returns an pointer to an ExtractOptions structure
@@ -42,20 +62,26 @@ func NewExtractOptions() *ExtractOptions {
 		Stdout:            os.Stdout,
 		Stderr:            os.Stderr,
 		Errors:            []error{},
+
+		AllowSymlinksOutsideBase: false,
 	}
 }
 
 // Apply set metadata on a path according to configured rules.
-func (o *ExtractOptions) Apply(path string, h *tar.Header) error {
+func (o *ExtractOptions) Apply(path string, e *Entry) error {
 	var problems []string
 	if o.RestoreOwner {
-		if err := setOwner(path, h.Uid, h.Gid); err != nil {
+		uid, gid, err := o.resolveOwner(e.Uid, e.Gid)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if err := setOwner(path, uid, gid); err != nil {
 			problems = append(problems, errors.Wrap(err, "setOwner").Error())
 		}
 	}
 
 	if o.RestoreTimestamps {
-		if err := os.Chtimes(path, h.AccessTime, h.ModTime); err != nil {
+		// Entry carries no separate access time, so restore ModTime for both.
+		if err := os.Chtimes(path, e.ModTime, e.ModTime); err != nil {
 			problems = append(problems, errors.Wrap(err, "setTimes").Error())
 		}
 	}
@@ -66,12 +92,35 @@ func (o *ExtractOptions) Apply(path string, h *tar.Header) error {
 	return errors.New(strings.Join(problems, ", "))
 }
 
+// resolveOwner translates an archived uid/gid through the inverse
+// UIDMaps/GIDMaps, then applies ChownOverride if set.
+func (o *ExtractOptions) resolveOwner(uid, gid int) (int, int, error) {
+	mappedUID := uid
+	if v, ok := unmapID(uid, o.UIDMaps); ok {
+		mappedUID = v
+	} else if !o.AllowUnmappedIDs {
+		return 0, 0, UnmappedIDError{Kind: "uid", ID: uid}
+	}
+
+	mappedGID := gid
+	if v, ok := unmapID(gid, o.GIDMaps); ok {
+		mappedGID = v
+	} else if !o.AllowUnmappedIDs {
+		return 0, 0, UnmappedIDError{Kind: "gid", ID: gid}
+	}
+
+	if o.ChownOverride != nil {
+		mappedUID, mappedGID = o.ChownOverride.UID, o.ChownOverride.GID
+	}
+	return mappedUID, mappedGID, nil
+}
+
 // Extract extracts an archive to a given path according to the given rules.
 func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 	if opts == nil {
 		opts = NewExtractOptions()
 	}
-	base = cleanPath(base)
+	base = filepath.Clean(base)
 
 	bstat, err := os.Stat(base)
 	switch {
@@ -108,7 +157,7 @@ func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 
 	seen := map[string]bool{}
 	for {
-		h, err := a.tarR.Next()
+		e, err := a.backend.NextHeader()
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -116,9 +165,37 @@ func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 			return err
 		}
 
-		h.Name = cleanPath(h.Name)
-		h.Linkname = cleanPath(h.Name)
-		path := filepath.Join(base, h.Name)
+		e.Name = cleanPath(e.Name)
+
+		path, err := containedPath(base, e.Name)
+		if err != nil {
+			err = errors.Wrap(err, path)
+			opts.Errors = append(opts.Errors, err)
+			if opts.ShowErrors {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if opts.FailOnError {
+				return err
+			}
+			continue
+		}
+
+		if !opts.AllowSymlinksOutsideBase {
+			switch e.Typeflag {
+			case tar.TypeLink, tar.TypeSymlink:
+				if err := containedTarget(base, e.Name, e.Linkname, e.Typeflag); err != nil {
+					err = errors.Wrap(err, path)
+					opts.Errors = append(opts.Errors, err)
+					if opts.ShowErrors {
+						fmt.Fprintln(os.Stderr, err)
+					}
+					if opts.FailOnError {
+						return err
+					}
+					continue
+				}
+			}
+		}
 
 		// Check if the path to extract to already exists.
 		if _, err := os.Lstat(path); err == nil {
@@ -189,22 +266,22 @@ func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 		}
 
 		err = nil
-		switch h.Typeflag {
+		switch e.Typeflag {
 		case tar.TypeDir:
-			err = a.extractDir(base, h, opts)
+			err = a.extractDir(base, e, opts)
 			seen[path] = true
 		case tar.TypeReg, tar.TypeRegA:
-			err = a.extractFile(base, h, opts)
+			err = a.extractFile(base, e, opts)
 		case tar.TypeLink:
-			err = a.extractHardlink(base, h, opts)
+			err = a.extractHardlink(base, e, opts)
 		case tar.TypeSymlink:
-			err = a.extractSymlink(base, h, opts)
+			err = a.extractSymlink(base, e, opts)
 			continue // do not set any attributes
 		case tar.TypeChar, tar.TypeBlock:
-			err = a.extractDevice(base, h, opts)
+			err = a.extractDevice(base, e, opts)
 		default:
 			// Ignore unsupported types
-			err = fmt.Errorf("unsupported type (%v), skipping", h.Typeflag)
+			err = fmt.Errorf("unsupported type (%v), skipping", e.Typeflag)
 		}
 
 		if err != nil {
@@ -220,7 +297,7 @@ func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 			seen[filepath.Dir(path)] = true
 		}
 
-		if err = opts.Apply(path, h); err != nil {
+		if err = opts.Apply(path, e); err != nil {
 			err = errors.Wrap(err, path)
 			if opts.FailOnError {
 				return err
@@ -230,22 +307,27 @@ func (a *Archive) Extract(base string, opts *ExtractOptions) error {
 	return nil
 }
 
-func (a *Archive) extractDir(base string, h *tar.Header, opts *ExtractOptions) error {
-	path := filepath.Join(base, h.Name)
-	if err := os.MkdirAll(path, h.FileInfo().Mode().Perm()); err != nil {
+func (a *Archive) extractDir(base string, e *Entry, opts *ExtractOptions) error {
+	path := filepath.Join(base, e.Name)
+	if err := os.MkdirAll(path, e.Mode.Perm()); err != nil {
 		return errors.Wrap(err, "mkdir")
 	}
 	return nil
 }
 
-func (a *Archive) extractFile(base string, h *tar.Header, opts *ExtractOptions) error {
-	path := filepath.Join(base, h.Name)
-	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, h.FileInfo().Mode().Perm())
+func (a *Archive) extractFile(base string, e *Entry, opts *ExtractOptions) error {
+	path := filepath.Join(base, e.Name)
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.Mode.Perm())
 	if err != nil {
 		return errors.Wrap(err, "create")
 	}
 
-	if _, err = io.Copy(fd, a.tarR); err != nil {
+	var w io.Writer = fd
+	if a.Progress != nil {
+		w = &entryProgressWriter{w: fd, progress: a.Progress, path: e.Name, total: e.Size}
+	}
+
+	if _, err = io.Copy(w, a.backend.Body()); err != nil {
 		return errors.Wrap(err, "write")
 	}
 	return nil
@@ -256,3 +338,71 @@ type ExtractionAbortedError struct{}
 func (e ExtractionAbortedError) Error() string {
 	return "aborted by user"
 }
+
+// UnsafePathError is returned when an archive entry's path, or the target of
+// a link/symlink entry, would resolve outside of the extraction directory.
+type UnsafePathError struct {
+	Path string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe path escapes destination directory: %s", e.Path)
+}
+
+// containedPath joins base and name, verifying that the result stays within
+// base. Besides a plain filepath.Rel check it resolves symlinks in the
+// existing parent directories of the result so that a pre-existing symlink
+// cannot be (ab)used to redirect a later, seemingly safe, entry outside of
+// base (analogous to the breakout tests in moby/pkg/archive).
+func containedPath(base, name string) (string, error) {
+	path := filepath.Join(base, name)
+
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return path, UnsafePathError{Path: name}
+	}
+
+	resolvedBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return path, errors.Wrap(err, "EvalSymlinks")
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	switch {
+	case os.IsNotExist(err):
+		return path, nil
+	case err != nil:
+		return path, errors.Wrap(err, "EvalSymlinks")
+	case resolvedDir != resolvedBase && !strings.HasPrefix(resolvedDir, resolvedBase+string(os.PathSeparator)):
+		return path, UnsafePathError{Path: name}
+	}
+	return path, nil
+}
+
+// containedTarget verifies that the target of a TypeLink/TypeSymlink entry
+// stays within base once resolved, rejecting absolute targets and any ".."
+// sequences that would escape it.
+func containedTarget(base, name, linkname string, typeflag byte) error {
+	if linkname == "" {
+		return UnsafePathError{Path: name}
+	}
+	if filepath.IsAbs(linkname) {
+		return UnsafePathError{Path: linkname}
+	}
+
+	var target string
+	switch typeflag {
+	case tar.TypeLink:
+		// Hardlink targets are, like Name, relative to the archive root.
+		target = filepath.Join(base, cleanPath(linkname))
+	default:
+		// Symlink targets are relative to the directory the link itself resides in.
+		target = filepath.Join(filepath.Dir(filepath.Join(base, name)), linkname)
+	}
+
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return UnsafePathError{Path: linkname}
+	}
+	return nil
+}
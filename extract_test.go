@@ -0,0 +1,218 @@
+package sar
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// buildTar writes a tar archive from the given headers, each paired with the
+// body to write for it (ignored for non-regular entries).
+func buildTar(t *testing.T, entries []*tar.Header, bodies []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for i, h := range entries {
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatalf("WriteHeader(%s): %v", h.Name, err)
+		}
+		if h.Typeflag == tar.TypeReg && i < len(bodies) {
+			if _, err := w.Write([]byte(bodies[i])); err != nil {
+				t.Fatalf("write body for %s: %v", h.Name, err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// extractTarBytes extracts a tar archive built from raw bytes into base,
+// returning the error from Extract (opts defaults applied, overwrite on,
+// non-interactive).
+func extractTarBytes(t *testing.T, data []byte, base string, opts *ExtractOptions) error {
+	t.Helper()
+	if opts == nil {
+		opts = NewExtractOptions()
+	}
+	opts.Interactive = false
+	a := NewTar().WithReader(bytes.NewReader(data))
+	return a.Extract(base, opts)
+}
+
+// TestExtractAbsoluteDestination verifies that Extract accepts an absolute
+// destination directory (the ordinary CLI use case) instead of resolving it
+// relative to the process's CWD.
+func TestExtractAbsoluteDestination(t *testing.T) {
+	dir := t.TempDir()
+	data := buildTar(t, []*tar.Header{
+		{Name: "hello.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+	}, []string{"world"})
+
+	if !filepath.IsAbs(dir) {
+		t.Fatalf("t.TempDir() returned non-absolute path %q", dir)
+	}
+	if err := extractTarBytes(t, data, dir, nil); err != nil {
+		t.Fatalf("Extract(%q): %v", dir, err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "world" {
+		t.Fatalf("content = %q, want %q", got, "world")
+	}
+}
+
+// TestExtractSanitizesEntryNames verifies that an entry name containing
+// ".." is confined to the extraction directory (entryName is cleaned via
+// cleanPath before any containment check runs), rather than being allowed to
+// address a path above base.
+func TestExtractSanitizesEntryNames(t *testing.T) {
+	cases := []struct {
+		name, entry string
+	}{
+		{"dot-dot in name", "../evil.txt"},
+		{"nested dot-dot in name", "sub/../../evil.txt"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			outer := t.TempDir()
+			dir := filepath.Join(outer, "dest")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatalf("Mkdir: %v", err)
+			}
+			data := buildTar(t, []*tar.Header{
+				{Name: c.entry, Typeflag: tar.TypeReg, Mode: 0644, Size: 0},
+			}, nil)
+
+			if err := extractTarBytes(t, data, dir, nil); err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(outer, "evil.txt")); err == nil {
+				t.Fatalf("entry escaped destination directory into %s", outer)
+			}
+		})
+	}
+}
+
+// TestExtractNestedSymlinkStaysContained is a regression test for a
+// divergence between containedTarget (which resolves a symlink's target
+// relative to the entry's own directory, per POSIX symlink semantics) and
+// the code that actually wrote the symlink to disk, which used to resolve
+// it relative to base instead. For a symlink nested more than one level
+// deep the two disagreed, letting containedTarget approve a target that was
+// then written out pointing somewhere else entirely.
+func TestExtractNestedSymlinkStaysContained(t *testing.T) {
+	dir := t.TempDir()
+	// From a/b/, ".." x2 lands back at dir, so dir/etc/passwd is a legitimate
+	// in-base target despite the traversal segments.
+	data := buildTar(t, []*tar.Header{
+		{Name: "a/b/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd", Mode: 0777},
+	}, nil)
+
+	if err := extractTarBytes(t, data, dir, nil); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "a", "b", "link"))
+	if err != nil {
+		t.Fatalf("Readlink: %v", err)
+	}
+	resolved := filepath.Clean(filepath.Join(dir, "a", "b", target))
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || rel[:3] == ".."+string(os.PathSeparator) {
+		t.Fatalf("symlink target %q resolves to %q, which escapes %q", target, resolved, dir)
+	}
+}
+
+// TestExtractRejectsNestedSymlinkTraversal checks that a nested symlink
+// entry whose target genuinely escapes base (once resolved relative to its
+// own directory) is still rejected.
+func TestExtractRejectsNestedSymlinkTraversal(t *testing.T) {
+	dir := t.TempDir()
+	data := buildTar(t, []*tar.Header{
+		{Name: "a/b/link", Typeflag: tar.TypeSymlink, Linkname: "../../../etc/passwd", Mode: 0777},
+	}, nil)
+
+	opts := NewExtractOptions()
+	opts.FailOnError = true
+	opts.ShowErrors = false
+	err := extractTarBytes(t, data, dir, opts)
+	if err == nil {
+		t.Fatalf("Extract: expected error, got nil")
+	}
+	if _, ok := errors.Cause(err).(UnsafePathError); !ok {
+		t.Fatalf("Extract: error = %v, want UnsafePathError", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "a", "b", "link")); err == nil {
+		t.Fatalf("rejected symlink was written to disk")
+	}
+}
+
+// TestExtractRejectsPathTraversal is analogous to moby/pkg/archive's
+// breakout tests: the targets of link/symlink entries that would resolve
+// outside of the extraction directory must be rejected rather than written.
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			name: "symlink target escapes base",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd", Mode: 0777},
+			},
+		},
+		{
+			name: "absolute symlink target",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777},
+			},
+		},
+		{
+			name: "symlink escape then traverse through it",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/tmp", Mode: 0777},
+				{Name: "link/evil.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 0},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := buildTar(t, c.headers, nil)
+
+			opts := NewExtractOptions()
+			opts.FailOnError = true
+			opts.ShowErrors = false
+			err := extractTarBytes(t, data, dir, opts)
+			if err == nil {
+				t.Fatalf("Extract: expected error, got nil")
+			}
+			if _, ok := errors.Cause(err).(UnsafePathError); !ok {
+				t.Fatalf("Extract: error = %v, want UnsafePathError", err)
+			}
+
+			walkErr := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || path == dir {
+					return err
+				}
+				t.Errorf("unexpected entry written outside of the skip: %s", path)
+				return nil
+			})
+			if walkErr != nil {
+				t.Fatalf("Walk: %v", walkErr)
+			}
+		})
+	}
+}
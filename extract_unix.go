@@ -16,9 +16,9 @@ func setOwner(path string, uid, gid int) error {
 	return os.Chown(path, uid, gid)
 }
 
-func (a *Archive) extractHardlink(base string, h *tar.Header, opts *ExtractOptions) error {
-	newpath := filepath.Join(base, h.Name)
-	oldpath := filepath.Join(base, h.Linkname)
+func (a *Archive) extractHardlink(base string, e *Entry, opts *ExtractOptions) error {
+	newpath := filepath.Join(base, e.Name)
+	oldpath := filepath.Join(base, e.Linkname)
 
 	os.RemoveAll(newpath)
 	if err := os.Link(oldpath, newpath); err != nil {
@@ -27,22 +27,24 @@ func (a *Archive) extractHardlink(base string, h *tar.Header, opts *ExtractOptio
 	return nil
 }
 
-func (a *Archive) extractSymlink(base string, h *tar.Header, opts *ExtractOptions) error {
-	newpath := filepath.Join(base, h.Name)
-	oldpath := filepath.Join(base, h.Linkname)
+func (a *Archive) extractSymlink(base string, e *Entry, opts *ExtractOptions) error {
+	newpath := filepath.Join(base, e.Name)
 
+	// e.Linkname is written to disk as-is: like any symlink target, it is
+	// resolved by the OS relative to newpath's own directory, which is also
+	// how containedTarget validated it.
 	os.RemoveAll(newpath)
-	if err := os.Symlink(oldpath, newpath); err != nil {
+	if err := os.Symlink(e.Linkname, newpath); err != nil {
 		return errors.Wrap(err, "symlink")
 	}
 	return nil
 }
 
-func (a *Archive) extractDevice(base string, h *tar.Header, opts *ExtractOptions) error {
-	path := filepath.Join(base, h.Name)
-	dev := unix.Mkdev(uint32(h.Devmajor), uint32(h.Devminor))
-	mode := h.Mode
-	switch h.Typeflag {
+func (a *Archive) extractDevice(base string, e *Entry, opts *ExtractOptions) error {
+	path := filepath.Join(base, e.Name)
+	dev := unix.Mkdev(uint32(e.Devmajor), uint32(e.Devminor))
+	mode := uint32(e.Mode.Perm())
+	switch e.Typeflag {
 	case tar.TypeChar:
 		mode |= unix.S_IFCHR
 	case tar.TypeBlock:
@@ -51,7 +53,7 @@ func (a *Archive) extractDevice(base string, h *tar.Header, opts *ExtractOptions
 		return errors.New("unknown device type")
 	}
 
-	if err := syscall.Mknod(path, uint32(mode), int(dev)); err != nil {
+	if err := syscall.Mknod(path, mode, int(dev)); err != nil {
 		return errors.Wrap(err, "mknod")
 	}
 	return nil
@@ -3,7 +3,6 @@
 package sar
 
 import (
-	"archive/tar"
 	"path/filepath"
 
 	"github.com/pkg/errors"
@@ -15,9 +14,9 @@ func setOwner(path string, uid, gid int) error {
 }
 
 // extractHardlink copies the linked file instead of creating a hard link on Windows.
-func (a *Archive) extractHardlink(base string, h *tar.Header, opts *ExtractOptions) error {
-	newpath := filepath.Join(base, h.Name)
-	oldpath := filepath.Join(base, h.Linkname)
+func (a *Archive) extractHardlink(base string, e *Entry, opts *ExtractOptions) error {
+	newpath := filepath.Join(base, e.Name)
+	oldpath := filepath.Join(base, e.Linkname)
 
 	if err := copy(oldpath, newpath); err != nil {
 		return errors.Wrap(err, "copy (hardlink)")
@@ -25,10 +24,12 @@ func (a *Archive) extractHardlink(base string, h *tar.Header, opts *ExtractOptio
 	return nil
 }
 
-// extractSymlink copies the linked file instead of creating a symbolic link on Windows.
-func (a *Archive) extractSymlink(base string, h *tar.Header, opts *ExtractOptions) error {
-	newpath := filepath.Join(base, h.Name)
-	oldpath := filepath.Join(base, h.Linkname)
+// extractSymlink copies the linked file instead of creating a symbolic link
+// on Windows. Like a real symlink target, e.Linkname is resolved relative to
+// newpath's own directory, which is also how containedTarget validated it.
+func (a *Archive) extractSymlink(base string, e *Entry, opts *ExtractOptions) error {
+	newpath := filepath.Join(base, e.Name)
+	oldpath := filepath.Join(filepath.Dir(newpath), e.Linkname)
 
 	if err := copy(oldpath, newpath); err != nil {
 		return errors.Wrap(err, "copy (symlink)")
@@ -37,6 +38,6 @@ func (a *Archive) extractSymlink(base string, h *tar.Header, opts *ExtractOption
 }
 
 // Extracting device files is not supported on Windows.
-func (a *Archive) extractDevice(base string, h *tar.Header, opts *ExtractOptions) error {
+func (a *Archive) extractDevice(base string, e *Entry, opts *ExtractOptions) error {
 	return nil
 }
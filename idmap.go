@@ -0,0 +1,59 @@
+package sar
+
+import "fmt"
+
+// IDMap represents one mapping line of a uid_map/gid_map-style mapping:
+// Size IDs starting at ContainerID map to HostID and up, analogous to
+// user-namespace ID mappings.
+type IDMap struct {
+	ContainerID int
+	HostID      int
+	Size        int
+}
+
+// Ownership holds a UID/GID pair, used by ChownOverride to force the
+// owner written to, or restored from, an archive.
+type Ownership struct {
+	UID int
+	GID int
+}
+
+// UnmappedIDError is returned when a UID or GID has no matching entry in
+// the configured UIDMaps/GIDMaps and AllowUnmappedIDs is not set.
+type UnmappedIDError struct {
+	Kind string // "uid" or "gid"
+	ID   int
+}
+
+func (e UnmappedIDError) Error() string {
+	return fmt.Sprintf("no mapping for %s %d", e.Kind, e.ID)
+}
+
+// mapID translates id through maps in the ContainerID -> HostID direction.
+// It returns id unchanged with ok=true if maps is empty; ok is false if a
+// non-empty maps has no entry covering id.
+func mapID(id int, maps []IDMap) (mapped int, ok bool) {
+	if len(maps) == 0 {
+		return id, true
+	}
+	for _, m := range maps {
+		if id >= m.ContainerID && id < m.ContainerID+m.Size {
+			return m.HostID + (id - m.ContainerID), true
+		}
+	}
+	return 0, false
+}
+
+// unmapID translates id through maps in the HostID -> ContainerID
+// direction, the inverse of mapID.
+func unmapID(id int, maps []IDMap) (mapped int, ok bool) {
+	if len(maps) == 0 {
+		return id, true
+	}
+	for _, m := range maps {
+		if id >= m.HostID && id < m.HostID+m.Size {
+			return m.ContainerID + (id - m.HostID), true
+		}
+	}
+	return 0, false
+}
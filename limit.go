@@ -1,6 +1,36 @@
 package sar
 
-import "io"
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Progress is notified of read/write progress while an archive is created
+// or extracted.
+type Progress interface {
+	// Update reports that bytesDone out of bytesTotal bytes have been
+	// processed for currentPath. bytesTotal is 0 if the total is unknown.
+	Update(bytesDone, bytesTotal int64, currentPath string)
+}
+
+// entryProgressWriter wraps a writer, reporting progress for a single
+// archive entry of a known total size, e.g. while extracting a file.
+type entryProgressWriter struct {
+	w        io.Writer
+	progress Progress
+	path     string
+	total    int64
+	done     int64
+}
+
+func (w *entryProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.done += int64(n)
+	w.progress.Update(w.done, w.total, w.path)
+	return n, err
+}
 
 // WriteLimitExceeded is an error object returned when a write would exceed a set limit.
 type WriteLimitExceeded struct{}
@@ -43,3 +73,86 @@ func (w *LimitWriter) Write(p []byte) (int, error) {
 	w.written += int64(n)
 	return n, err
 }
+
+// rateLimitBurst is the token bucket burst size used for rate-limited
+// readers/writers. It is kept independent of the configured rate so that a
+// single Read/Write larger than the per-second rate (as tar/gzip routinely
+// issue, e.g. 32KiB internal buffers) doesn't exceed the limiter's burst and
+// make rate.Limiter.WaitN fail outright; callers are still throttled to the
+// configured rate over time, just not on a per-call basis below this size.
+const rateLimitBurst = 64 * 1024
+
+// waitN drains n tokens from lim, splitting the request into chunks no
+// larger than lim's burst size so that callers can pass arbitrarily large
+// byte counts without tripping rate.ErrBurstExceeded.
+func waitN(ctx context.Context, lim *rate.Limiter, n int) error {
+	burst := lim.Burst()
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := lim.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// rateLimitedWriter throttles writes to a writer to a maximum number of
+// bytes per second using a token bucket.
+type rateLimitedWriter struct {
+	w   io.Writer
+	lim *rate.Limiter
+}
+
+// newRateLimitedWriter returns a writer wrapping w, throttled to
+// bytesPerSec bytes per second.
+func newRateLimitedWriter(w io.Writer, bytesPerSec int64) *rateLimitedWriter {
+	burst := int(bytesPerSec)
+	if burst < rateLimitBurst {
+		burst = rateLimitBurst
+	}
+	return &rateLimitedWriter{
+		w:   w,
+		lim: rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	if err := waitN(context.Background(), w.lim, len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// rateLimitedReader throttles reads from a reader to a maximum number of
+// bytes per second using a token bucket.
+type rateLimitedReader struct {
+	r   io.Reader
+	lim *rate.Limiter
+}
+
+// newRateLimitedReader returns a reader wrapping r, throttled to
+// bytesPerSec bytes per second.
+func newRateLimitedReader(r io.Reader, bytesPerSec int64) *rateLimitedReader {
+	burst := int(bytesPerSec)
+	if burst < rateLimitBurst {
+		burst = rateLimitBurst
+	}
+	return &rateLimitedReader{
+		r:   r,
+		lim: rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := waitN(context.Background(), r.lim, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,45 @@
+// Package progress provides a simple terminal implementation of
+// sar.Progress.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Terminal is a sar.Progress implementation that prints a single-line,
+// carriage-return-updated progress indicator to Writer.
+type Terminal struct {
+	Writer   io.Writer     // Writer is where the progress indicator is printed to.
+	Interval time.Duration // Interval throttles how often the line is redrawn. 0 means "on every update".
+
+	last time.Time
+}
+
+// NewTerminal returns a pointer to a new Terminal progress reporter writing
+// to w, redrawing at most once per interval.
+func NewTerminal(w io.Writer, interval time.Duration) *Terminal {
+	return &Terminal{Writer: w, Interval: interval}
+}
+
+// Update implements sar.Progress.
+func (t *Terminal) Update(bytesDone, bytesTotal int64, currentPath string) {
+	now := time.Now()
+	if t.Interval > 0 && !t.last.IsZero() && now.Sub(t.last) < t.Interval {
+		return
+	}
+	t.last = now
+
+	if bytesTotal > 0 {
+		pct := float64(bytesDone) / float64(bytesTotal) * 100
+		fmt.Fprintf(t.Writer, "\r%6.2f%%  %s", pct, currentPath)
+	} else {
+		fmt.Fprintf(t.Writer, "\r%d bytes  %s", bytesDone, currentPath)
+	}
+}
+
+// Done finishes the progress display by moving to a new line.
+func (t *Terminal) Done() {
+	fmt.Fprintln(t.Writer)
+}
@@ -15,3 +15,37 @@ func NewTarGz() *Archive {
 		Compressor: CompressorGzip,
 	}
 }
+
+// NewTarBz2 returns a pointer to a new Tar+Bzip2 archive structure.
+func NewTarBz2() *Archive {
+	return &Archive{
+		Type:       TypeTar,
+		Compressor: CompressorBzip2,
+	}
+}
+
+// NewTarXz returns a pointer to a new Tar+Xz archive structure.
+func NewTarXz() *Archive {
+	return &Archive{
+		Type:       TypeTar,
+		Compressor: CompressorXz,
+	}
+}
+
+// NewTarZstd returns a pointer to a new Tar+Zstd archive structure.
+func NewTarZstd() *Archive {
+	return &Archive{
+		Type:       TypeTar,
+		Compressor: CompressorZstd,
+	}
+}
+
+// NewTarAuto returns a pointer to a new Tar archive structure whose
+// compression is auto-detected on read from the archive's magic number, see
+// DetectCompression.
+func NewTarAuto() *Archive {
+	return &Archive{
+		Type:       TypeTar,
+		Compressor: CompressorAuto,
+	}
+}
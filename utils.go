@@ -3,8 +3,57 @@ package sar
 import (
 	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// cleanPath sanitizes an archive entry path so that it cannot escape the
+// destination directory through a leading slash or ".." elements, e.g.
+// "/etc/passwd" and "../../etc/passwd" both become "etc/passwd".
+func cleanPath(p string) string {
+	p = filepath.ToSlash(p)
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// byteSizeUnits maps a size suffix to its factor in bytes, checked longest
+// suffix first so "KiB" isn't shadowed by "B".
+var byteSizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a human-readable byte size such as "10MiB", "1.5GB"
+// or "10MiB/s" (the optional "/s" suffix, as used for rate limits, is
+// ignored) and returns the corresponding number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "/s")
+
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, errors.Wrap(err, "parse size")
+			}
+			return int64(v * u.factor), nil
+		}
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse size")
+	}
+	return v, nil
+}
+
 func copy(src, dst string) error {
 	rstat, err := os.Lstat(src)
 	if err != nil {
@@ -0,0 +1,9 @@
+package sar
+
+// NewZip returns a pointer to a new Zip archive structure. Compression is
+// intrinsic to the zip format, so Compressor is ignored.
+func NewZip() *Archive {
+	return &Archive{
+		Type: TypeZip,
+	}
+}